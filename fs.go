@@ -0,0 +1,117 @@
+package maildir
+
+import (
+	"io"
+	"os"
+)
+
+// A File is an open file as returned by an FS's Open and Create
+// methods.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+}
+
+// An FS abstracts the filesystem operations a Dir performs, so that a
+// maildir can be backed by something other than the local disk, such as
+// an in-memory filesystem for tests, or a remote/overlay filesystem in
+// production. OSFS, backed by the os package, is used unless a Dir's
+// own FS field is set.
+type FS interface {
+	Open(name string) (File, error)
+	Create(name string) (File, error)
+	Rename(oldpath, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	ReadDir(name string) ([]os.DirEntry, error)
+	Stat(name string) (os.FileInfo, error)
+	Mkdir(name string, perm os.FileMode) error
+}
+
+// A Linker is implemented by FS values that can hard-link a file, such
+// as OSFS. Copy and Move use it as an optimization when the destination
+// Dir's FS implements it, falling back to a plain copy otherwise or when
+// the link fails. The source Dir's FS is not checked.
+type Linker interface {
+	Link(oldname, newname string) error
+}
+
+// OSFS is the default FS. It is backed by the local filesystem, via the
+// functions of the same name in the os package.
+type OSFS struct{}
+
+// Open implements FS.
+func (OSFS) Open(name string) (File, error) { return os.Open(name) }
+
+// Create implements FS.
+func (OSFS) Create(name string) (File, error) { return os.Create(name) }
+
+// Rename implements FS.
+func (OSFS) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+// Remove implements FS.
+func (OSFS) Remove(name string) error { return os.Remove(name) }
+
+// RemoveAll implements FS.
+func (OSFS) RemoveAll(path string) error { return os.RemoveAll(path) }
+
+// ReadDir implements FS.
+func (OSFS) ReadDir(name string) ([]os.DirEntry, error) { return os.ReadDir(name) }
+
+// Stat implements FS.
+func (OSFS) Stat(name string) (os.FileInfo, error) { return os.Stat(name) }
+
+// Mkdir implements FS.
+func (OSFS) Mkdir(name string, perm os.FileMode) error { return os.Mkdir(name, perm) }
+
+// Link implements Linker.
+func (OSFS) Link(oldname, newname string) error { return os.Link(oldname, newname) }
+
+// DefaultFS is the FS used by a Dir whose own FS field is nil.
+var DefaultFS FS = OSFS{}
+
+// fs returns d.FS, or DefaultFS if d has none.
+func (d Dir) fs() FS {
+	if d.FS != nil {
+		return d.FS
+	}
+	return DefaultFS
+}
+
+// mkdirAll creates path and any missing parents on fs, in the manner of
+// os.MkdirAll.
+func mkdirAll(fs FS, path string, perm os.FileMode) error {
+	if path == "" || path == "." || path == string(os.PathSeparator) {
+		return nil
+	}
+	if info, err := fs.Stat(path); err == nil {
+		if info.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: path, Err: os.ErrExist}
+	}
+	var parent string
+	if i := lastIndexByte(path, os.PathSeparator); i >= 0 {
+		parent = path[:i]
+	}
+	if err := mkdirAll(fs, parent, perm); err != nil {
+		return err
+	}
+	err := fs.Mkdir(path, perm)
+	if err != nil && os.IsExist(err) {
+		return nil
+	}
+	return err
+}
+
+// lastIndexByte returns the index of the last occurrence of b in s, or
+// -1 if b is not present.
+func lastIndexByte(s string, b byte) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == b {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,106 @@
+package maildir
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// A Generator produces the components of the unique filenames used when
+// Copy, Move and deliveries create a message: the hostname and PID
+// recorded in the key, the separator placed before the info part of the
+// filename, and the clock (and, optionally, a source of randomness) used
+// to make keys unique, alongside an internal counter that keeps rapid
+// deliveries through the same Generator from colliding. The zero
+// Generator behaves exactly like the package's built-in default.
+type Generator struct {
+	// Hostname is recorded in generated keys. If empty, os.Hostname is
+	// used.
+	Hostname string
+	// PID is recorded in generated keys in place of the running
+	// process's PID, if non-zero.
+	PID int
+	// Separator overrides the package-wide Separator for messages
+	// delivered or renamed through this Generator's Dir. This is mainly
+	// useful on filesystems where ':' isn't a legal filename character,
+	// where it should be set to something like '!' or '-'.
+	Separator rune
+	// Now, if set, is called instead of time.Now to timestamp new keys.
+	// Tests can set this for reproducible output.
+	Now func() time.Time
+	// Rand, if set, is called for an extra component appended to new
+	// keys. Tests can set this for reproducible output; production code
+	// normally leaves it nil, since the hostname, PID, clock and
+	// delivery counter already make keys unique.
+	Rand func() int64
+
+	// seq is a per-Generator delivery counter, so that two keys
+	// generated in the same process within one clock tick still
+	// differ. It is safe for concurrent use.
+	seq atomic.Uint64
+}
+
+// key returns a newly generated, unique key.
+func (g *Generator) key() string {
+	host := g.Hostname
+	if host == "" {
+		if h, err := os.Hostname(); err == nil {
+			host = h
+		} else {
+			host = "localhost"
+		}
+	}
+	host = strings.NewReplacer("/", "\\057", string(g.separator()), "\\072").Replace(host)
+
+	pid := g.PID
+	if pid == 0 {
+		pid = os.Getpid()
+	}
+
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+
+	seq := g.seq.Add(1)
+	key := fmt.Sprintf("%d.P%d.Q%d.%s", now().UnixNano(), pid, seq, host)
+	if g.Rand != nil {
+		key += fmt.Sprintf(".R%d", g.Rand())
+	}
+	return key
+}
+
+// separator returns the Generator's configured Separator, falling back
+// to the package-wide Separator when none was set.
+func (g *Generator) separator() rune {
+	if g.Separator != 0 {
+		return g.Separator
+	}
+	return Separator
+}
+
+// DefaultGenerator is the Generator used by a Dir whose own Generator
+// field is nil.
+var DefaultGenerator = &Generator{}
+
+// generator returns d.Generator, or DefaultGenerator if d has none.
+func (d Dir) generator() *Generator {
+	if d.Generator != nil {
+		return d.Generator
+	}
+	return DefaultGenerator
+}
+
+// separator returns the info separator used by d: the Separator of d's
+// own Generator, or the package-wide Separator if d has none.
+func (d Dir) separator() rune {
+	return d.generator().separator()
+}
+
+// generateKey returns a newly generated key, unique within d, using d's
+// configured Generator.
+func (d Dir) generateKey() string {
+	return d.generator().key()
+}
@@ -7,8 +7,8 @@ import (
 	"io"
 	"net/mail"
 	"net/textproto"
-	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -29,51 +29,196 @@ func (e *KeyError) Error() string {
 }
 
 // A Dir represents a single directory in a Maildir mailbox.
-type Dir string
+//
+// The zero Dir is not usable; construct one with Open, or with a
+// composite literal giving at least Path. Generator and FS, if set,
+// override DefaultGenerator and DefaultFS for every operation on this
+// Dir, including folders a Store derives from it.
+type Dir struct {
+	// Path is the directory's location, e.g. "/home/user/Maildir".
+	Path string
+	// Generator, if non-nil, is used instead of DefaultGenerator to
+	// produce keys and the info separator for this Dir.
+	Generator *Generator
+	// FS, if non-nil, is used instead of DefaultFS for all filesystem
+	// access by this Dir.
+	FS FS
+}
+
+// Open returns the Dir rooted at path, using DefaultGenerator and
+// DefaultFS.
+func Open(path string) Dir {
+	return Dir{Path: path}
+}
+
+// sub returns a Dir at path, inheriting d's Generator and FS. It is
+// used to derive a Store folder's Dir from its root without losing the
+// root's configuration.
+func (d Dir) sub(path string) Dir {
+	return Dir{Path: path, Generator: d.Generator, FS: d.FS}
+}
+
+// A Flag is one of the single-character message flags defined by the
+// Maildir spec. Flags are stored in the "info" part of a message's
+// filename, e.g. the "S" in "1084533424.P11978.hawkwind:2,S".
+type Flag rune
+
+// The flags defined by the Maildir spec. See
+// http://cr.yp.to/proto/maildir.html for what each of them means.
+const (
+	Replied Flag = 'R'
+	Seen    Flag = 'S'
+	Trashed Flag = 'T'
+	Flagged Flag = 'F'
+	Draft   Flag = 'D'
+	Passed  Flag = 'P'
+)
+
+// keyAndInfo splits a message's filename into its key and, if present,
+// the "2,<flags>" info part described by the Maildir spec, using d's
+// configured separator.
+func (d Dir) keyAndInfo(filename string) (key, info string) {
+	base := filepath.Base(filename)
+	parts := strings.SplitN(base, string(d.separator()), 2)
+	if len(parts) != 2 {
+		return base, ""
+	}
+	return parts[0], parts[1]
+}
+
+// flagsFromInfo parses the flags out of an info string such as "2,FS".
+// Info strings that do not carry the "2," version prefix have no flags.
+func flagsFromInfo(info string) []Flag {
+	if !strings.HasPrefix(info, "2,") {
+		return nil
+	}
+	var flags []Flag
+	for _, r := range info[len("2,"):] {
+		flags = append(flags, Flag(r))
+	}
+	return flags
+}
+
+// sortFlags returns a sorted copy of flags, as required by the Maildir
+// spec, which states that flags must appear in ASCII order.
+func sortFlags(flags []Flag) []Flag {
+	sorted := append([]Flag(nil), flags...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
+// hasFlag reports whether flags contains f.
+func hasFlag(flags []Flag, f Flag) bool {
+	for _, g := range flags {
+		if g == f {
+			return true
+		}
+	}
+	return false
+}
+
+// Flags returns the flags currently set on the message matching key.
+func (d Dir) Flags(key string) ([]Flag, error) {
+	filename, err := d.Filename(key)
+	if err != nil {
+		return nil, err
+	}
+	_, info := d.keyAndInfo(filename)
+	return flagsFromInfo(info), nil
+}
+
+// Rename updates the flags of the message matching key by renaming its
+// underlying file within d. The rename happens on the same filesystem,
+// so it is atomic, and the resulting flags are sorted alphabetically as
+// required by the Maildir spec.
+func (d Dir) Rename(key string, flags []Flag) error {
+	filename, err := d.Filename(key)
+	if err != nil {
+		return err
+	}
+	var info strings.Builder
+	info.WriteString("2,")
+	for _, f := range sortFlags(flags) {
+		info.WriteRune(rune(f))
+	}
+	newname := filepath.Join(filepath.Dir(filename), key+string(d.separator())+info.String())
+	return d.fs().Rename(filename, newname)
+}
+
+// SetFlags replaces the flags set on the message matching key with
+// flags. It is a convenience wrapper around Rename.
+func (d Dir) SetFlags(key string, flags []Flag) error {
+	return d.Rename(key, flags)
+}
+
+// AddFlags sets flags on the message matching key, in addition to any
+// flags already present, and renames the underlying file to match.
+func (d Dir) AddFlags(key string, flags ...Flag) error {
+	existing, err := d.Flags(key)
+	if err != nil {
+		return err
+	}
+	for _, f := range flags {
+		if !hasFlag(existing, f) {
+			existing = append(existing, f)
+		}
+	}
+	return d.SetFlags(key, existing)
+}
+
+// RemoveFlags clears flags from the message matching key and renames
+// the underlying file to match.
+func (d Dir) RemoveFlags(key string, flags ...Flag) error {
+	existing, err := d.Flags(key)
+	if err != nil {
+		return err
+	}
+	var kept []Flag
+	for _, f := range existing {
+		if !hasFlag(flags, f) {
+			kept = append(kept, f)
+		}
+	}
+	return d.SetFlags(key, kept)
+}
 
 // Unseen moves messages from new to cur (they are now "seen") and returns their keys.
 // This is the only function in this package that operates on any subdirectory
 // other than "cur".
 func (d Dir) Unseen() ([]string, error) {
-	f, err := os.Open(filepath.Join(string(d), "new"))
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	names, err := f.Readdirnames(0)
+	entries, err := d.fs().ReadDir(filepath.Join(d.Path, "new"))
 	if err != nil {
 		return nil, err
 	}
 	var keys []string
-	for _, n := range names {
+	for _, entry := range entries {
+		n := entry.Name()
 		if n[0] != '.' {
 			split := strings.FieldsFunc(n, func(r rune) bool {
-				return r == Separator
+				return r == d.separator()
 			})
 			keys = append(keys, split[0])
-			os.Rename(filepath.Join(string(d), "new", n),
-				filepath.Join(string(d), "cur", n+string(Separator)+"2,S"))
+			d.fs().Rename(filepath.Join(d.Path, "new", n),
+				filepath.Join(d.Path, "cur", n+string(d.separator())+"2,"+string(rune(Seen))))
 		}
 	}
 	return keys, nil
 }
 
-// Keys returns a slice of valid keys to access messages by.
+// Keys returns a slice of valid keys to access messages by. This works
+// regardless of what flags, if any, a message's filename carries after
+// d's separator.
 func (d Dir) Keys() ([]string, error) {
-	f, err := os.Open(filepath.Join(string(d), "cur/"))
-	if err != nil {
-		return nil, err
-	}
-	defer f.Close()
-	names, err := f.Readdirnames(0)
+	entries, err := d.fs().ReadDir(filepath.Join(d.Path, "cur"))
 	if err != nil {
 		return nil, err
 	}
 	var keys []string
-	for _, n := range names {
+	for _, entry := range entries {
+		n := entry.Name()
 		if n[0] != '.' {
 			split := strings.FieldsFunc(n, func(r rune) bool {
-				return r == ':'
+				return r == d.separator()
 			})
 			keys = append(keys, split[0])
 		}
@@ -81,12 +226,20 @@ func (d Dir) Keys() ([]string, error) {
 	return keys, nil
 }
 
-// Filename returns the path to the file corresponding to the key.
+// Filename returns the path to the file corresponding to the key. This
+// works regardless of what flags, if any, the message's filename carries
+// after Separator.
 func (d Dir) Filename(key string) (string, error) {
-	matches, err := filepath.Glob(filepath.Join(string(d), "cur", key+"*"))
+	entries, err := d.fs().ReadDir(filepath.Join(d.Path, "cur"))
 	if err != nil {
 		return "", err
 	}
+	var matches []string
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), key) {
+			matches = append(matches, filepath.Join(d.Path, "cur", entry.Name()))
+		}
+	}
 	if n := len(matches); n != 1 {
 		return "", &KeyError{key, n}
 	}
@@ -99,7 +252,7 @@ func (d Dir) Header(key string) (header mail.Header, err error) {
 	if err != nil {
 		return
 	}
-	file, err := os.Open(filename)
+	file, err := d.fs().Open(filename)
 	if err != nil {
 		return
 	}
@@ -119,7 +272,7 @@ func (d Dir) Message(key string) (*mail.Message, error) {
 	if err != nil {
 		return &mail.Message{}, err
 	}
-	r, err := os.Open(filename)
+	r, err := d.fs().Open(filename)
 	if err != nil {
 		return &mail.Message{}, err
 	}
@@ -134,4 +287,154 @@ func (d Dir) Message(key string) (*mail.Message, error) {
 		return msg, err
 	}
 	return msg, nil
-}
\ No newline at end of file
+}
+
+// Copy duplicates the message matching key into target as a newly
+// delivered message, writing it through target's tmp directory before
+// renaming it into cur, and returns the new key it was given. Keys are
+// only unique within a single maildir, so the copy cannot keep key; its
+// flags, however, are preserved. Unlike Move, the message in d is left
+// untouched.
+func (d Dir) Copy(target Dir, key string) (string, error) {
+	return d.deliverInto(target, key)
+}
+
+// Move moves the message matching key from d into target, giving it a
+// freshly generated key in target, and removes it from d. Like Copy, it
+// is implemented by writing through target's tmp directory so that the
+// move is safe even across filesystem boundaries.
+func (d Dir) Move(target Dir, key string) error {
+	newKey, err := d.deliverInto(target, key)
+	if err != nil {
+		return err
+	}
+	filename, err := d.Filename(key)
+	if err != nil {
+		return err
+	}
+	if err := d.fs().Remove(filename); err != nil {
+		target.Purge(newKey)
+		return err
+	}
+	return nil
+}
+
+// Purge permanently deletes the message matching key from d.
+func (d Dir) Purge(key string) error {
+	filename, err := d.Filename(key)
+	if err != nil {
+		return err
+	}
+	return d.fs().Remove(filename)
+}
+
+// Create makes d's tmp, new and cur subdirectories, along with d itself
+// and any missing parents, so that d is ready to receive deliveries. It
+// is not an error for d to already exist.
+func (d Dir) Create() error {
+	for _, subdir := range []string{"tmp", "new", "cur"} {
+		if err := mkdirAll(d.fs(), filepath.Join(d.Path, subdir), 0700); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverInto delivers the message matching key into target under a
+// freshly generated key and returns that key. The source file is
+// hard-linked into target's tmp directory when target's FS implements
+// Linker, falling back to a plain copy when it does not or when the
+// link fails.
+func (d Dir) deliverInto(target Dir, key string) (string, error) {
+	filename, err := d.Filename(key)
+	if err != nil {
+		return "", err
+	}
+	_, info := d.keyAndInfo(filename)
+	newKey := target.generateKey()
+	tmpname := filepath.Join(target.Path, "tmp", newKey)
+	if err := d.linkOrCopy(target, filename, tmpname); err != nil {
+		return "", err
+	}
+	curname := newKey
+	if info != "" {
+		curname += string(target.separator()) + info
+	}
+	if err := target.fs().Rename(tmpname, filepath.Join(target.Path, "cur", curname)); err != nil {
+		target.fs().Remove(tmpname)
+		return "", err
+	}
+	return newKey, nil
+}
+
+// A Delivery represents a message being written into a Dir's tmp
+// directory. Until Close moves it into new, it is invisible to Keys,
+// Unseen and the rest of the package, as required by the Maildir spec.
+type Delivery struct {
+	d       Dir
+	key     string
+	tmpname string
+	file    File
+}
+
+// NewDelivery begins delivering a new message into d, using d's
+// configured Generator to produce its key, and returns a Delivery to
+// write the message's content to. The message is not visible in d
+// until the Delivery is Closed.
+func (d Dir) NewDelivery() (*Delivery, error) {
+	key := d.generateKey()
+	tmpname := filepath.Join(d.Path, "tmp", key)
+	file, err := d.fs().Create(tmpname)
+	if err != nil {
+		return nil, err
+	}
+	return &Delivery{d: d, key: key, tmpname: tmpname, file: file}, nil
+}
+
+// Write appends p to the message being delivered.
+func (del *Delivery) Write(p []byte) error {
+	_, err := del.file.Write(p)
+	return err
+}
+
+// Close finishes the delivery, moving the message from tmp into new
+// where it becomes visible.
+func (del *Delivery) Close() error {
+	if err := del.file.Close(); err != nil {
+		return err
+	}
+	return del.d.fs().Rename(del.tmpname, filepath.Join(del.d.Path, "new", del.key))
+}
+
+// linkOrCopy places the content found at src on d's filesystem at dst
+// on target's filesystem. If target's filesystem implements Linker, a
+// hard link is tried first as an optimization; otherwise, and whenever
+// linking fails (for example because src and dst aren't on the same
+// underlying filesystem), the content is copied instead.
+func (d Dir) linkOrCopy(target Dir, src, dst string) error {
+	if linker, ok := target.fs().(Linker); ok {
+		if err := linker.Link(src, dst); err == nil {
+			return nil
+		}
+	}
+	return copyFile(d.fs(), target.fs(), src, dst)
+}
+
+// copyFile copies the contents of src on srcFS into a new file at dst
+// on dstFS.
+func copyFile(srcFS, dstFS FS, src, dst string) error {
+	in, err := srcFS.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := dstFS.Create(dst)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
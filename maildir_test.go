@@ -10,7 +10,7 @@ import (
 // cleanup removes a Dir's directory structure
 func cleanup(t *testing.T, d Dir) {
 
-	err := os.RemoveAll(string(d))
+	err := os.RemoveAll(d.Path)
 	if err != nil {
 		t.Error(err)
 	}
@@ -71,7 +71,7 @@ func TestCreate(t *testing.T) {
 
 	t.Parallel()
 
-	var d Dir = "test_create"
+	d := Open("test_create")
 	err := d.Create()
 	if err != nil {
 		t.Fatal(err)
@@ -83,7 +83,7 @@ func TestDelivery(t *testing.T) {
 
 	t.Parallel()
 
-	var d Dir = "test_delivery"
+	d := Open("test_delivery")
 	msgs := []string{
 		"this is the first message",
 		"a second message follows",
@@ -133,7 +133,7 @@ func TestPurge(t *testing.T) {
 
 	t.Parallel()
 
-	var d Dir = "test_purge"
+	d := Open("test_purge")
 
 	err := d.Create()
 	if err != nil {
@@ -163,12 +163,128 @@ func TestPurge(t *testing.T) {
 	}
 }
 
+func TestFlags(t *testing.T) {
+
+	t.Parallel()
+
+	d := Open("test_flags")
+
+	err := d.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup(t, d)
+
+	makeDelivery(t, d, "a flagged message")
+
+	keys, err := d.Unseen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := keys[0]
+
+	cases := []struct {
+		name     string
+		do       func() error
+		wantInfo string // the "2,<flags>" suffix of the resulting filename
+	}{
+		{
+			name:     "SetFlags sorts unsorted flags alphabetically",
+			do:       func() error { return d.SetFlags(key, []Flag{Passed, Draft, Replied}) },
+			wantInfo: "2,DPR",
+		},
+		{
+			name:     "AddFlags adds without duplicating an existing flag",
+			do:       func() error { return d.AddFlags(key, Flagged, Replied) },
+			wantInfo: "2,DFPR",
+		},
+		{
+			name:     "RemoveFlags drops only the given flags",
+			do:       func() error { return d.RemoveFlags(key, Draft, Passed) },
+			wantInfo: "2,FR",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.do(); err != nil {
+				t.Fatal(err)
+			}
+
+			path, err := d.Filename(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, info := d.keyAndInfo(path)
+			if info != c.wantInfo {
+				t.Fatalf("info = %q, want %q", info, c.wantInfo)
+			}
+
+			flags, err := d.Flags(key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortFlags(flags); string(flagString(got)) != c.wantInfo[len("2,"):] {
+				t.Fatalf("Flags = %v, want the flags in %q", flags, c.wantInfo)
+			}
+		})
+	}
+}
+
+// flagString renders flags as they appear in a filename's info part.
+func flagString(flags []Flag) string {
+	s := make([]byte, len(flags))
+	for i, f := range flags {
+		s[i] = byte(f)
+	}
+	return string(s)
+}
+
+func TestFlagsNoInfoPart(t *testing.T) {
+
+	t.Parallel()
+
+	d := Open("test_flags_no_info")
+
+	err := d.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup(t, d)
+
+	const key = "bare-key"
+	if err := os.WriteFile(d.Path+"/cur/"+key, []byte("no info part"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	flags, err := d.Flags(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flags) != 0 {
+		t.Fatalf("Flags = %v, want none for a message with no info part", flags)
+	}
+
+	if err := d.AddFlags(key, Seen); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := d.Filename(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, info := d.keyAndInfo(path); info != "2,S" {
+		t.Fatalf("info = %q, want %q", info, "2,S")
+	}
+}
+
 func TestMove(t *testing.T) {
 
 	t.Parallel()
 
-	var d1 Dir = "test_move1"
-	var d2 Dir = "test_move2"
+	d1 := Open("test_move1")
+	d2 := Open("test_move2")
 	const msg = "a moving message"
 
 	err := d1.Create()
@@ -0,0 +1,144 @@
+package maildir
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// A FolderError occurs when an operation on a Store's folder cannot be
+// carried out.
+type FolderError struct {
+	Name   string // the folder name
+	Reason string // why the operation failed
+}
+
+func (e *FolderError) Error() string {
+	return "maildir: folder " + e.Name + ": " + e.Reason
+}
+
+// hierarchySeparator is the character Maildir++ uses to join the names
+// of nested folders into a single dot-prefixed directory name, e.g.
+// ".Archive.2024" for a folder "Archive.2024".
+const hierarchySeparator = "."
+
+// A Store represents a collection of maildirs rooted at a single
+// directory, such as a user's ~/Maildir. New folders are laid out in
+// Maildir++ style: each one is a dot-prefixed directory living directly
+// inside root, alongside its cur, new and tmp, named after its full path
+// in the hierarchy (e.g.
+// ".Sent", ".Archive.2024"). Plain one-level subdirectories of root are
+// also recognized as folders, for stores that predate Maildir++. The
+// root itself is the INBOX. Every Dir a Store hands out, including the
+// INBOX, shares root's Generator and FS.
+type Store struct {
+	root Dir
+}
+
+// NewStore returns a Store rooted at root. root itself is treated as
+// the INBOX and must already be a valid maildir.
+func NewStore(root Dir) *Store {
+	return &Store{root: root}
+}
+
+// folderPath returns the Dir a folder named name would live at, whether
+// or not it currently exists, in Maildir++ layout. An empty name refers
+// to the INBOX.
+func (s *Store) folderPath(name string) Dir {
+	if name == "" {
+		return s.root
+	}
+	return s.root.sub(filepath.Join(s.root.Path, hierarchySeparator+name))
+}
+
+// plainFolderPath returns the Dir a folder named name would live at if
+// laid out as a plain one-level subdirectory of root, rather than
+// Maildir++ style.
+func (s *Store) plainFolderPath(name string) Dir {
+	return s.root.sub(filepath.Join(s.root.Path, name))
+}
+
+// maildirSubdirs are the subdirectories that make up a maildir itself,
+// as opposed to a nested folder.
+var maildirSubdirs = map[string]bool{"tmp": true, "new": true, "cur": true}
+
+// ListFolders returns the name of every folder in the store, whether
+// laid out Maildir++ style (a dot-prefixed directory) or as a plain
+// one-level subdirectory, with '.' used to separate levels of the
+// Maildir++ hierarchy. The INBOX itself is not included.
+func (s *Store) ListFolders() ([]string, error) {
+	entries, err := s.root.fs().ReadDir(s.root.Path)
+	if err != nil {
+		return nil, err
+	}
+	var folders []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() || maildirSubdirs[name] {
+			continue
+		}
+		folders = append(folders, strings.TrimPrefix(name, hierarchySeparator))
+	}
+	return folders, nil
+}
+
+// Folder returns the Dir for the folder named name, or an error if it
+// does not exist. An empty name refers to the INBOX. Both Maildir++ and
+// plain one-level layouts are tried.
+func (s *Store) Folder(name string) (Dir, error) {
+	if name == "" {
+		return s.root, nil
+	}
+	dir := s.folderPath(name)
+	if _, err := s.root.fs().Stat(dir.Path); err == nil {
+		return dir, nil
+	}
+	plain := s.plainFolderPath(name)
+	if _, err := s.root.fs().Stat(plain.Path); err != nil {
+		return Dir{}, err
+	}
+	return plain, nil
+}
+
+// CreateFolder creates a new folder named name and returns its Dir.
+func (s *Store) CreateFolder(name string) (Dir, error) {
+	dir := s.folderPath(name)
+	if err := dir.Create(); err != nil {
+		return Dir{}, err
+	}
+	return dir, nil
+}
+
+// RemoveFolder deletes the folder named name and everything in it. It
+// refuses to remove the INBOX.
+func (s *Store) RemoveFolder(name string) error {
+	if name == "" {
+		return &FolderError{name, "cannot remove the INBOX"}
+	}
+	dir, err := s.Folder(name)
+	if err != nil {
+		return err
+	}
+	return s.root.fs().RemoveAll(dir.Path)
+}
+
+// Walk calls fn once for every folder in the store, including the
+// INBOX under the empty name, stopping at the first error fn returns.
+func (s *Store) Walk(fn func(name string, d Dir) error) error {
+	if err := fn("", s.root); err != nil {
+		return err
+	}
+	folders, err := s.ListFolders()
+	if err != nil {
+		return err
+	}
+	for _, name := range folders {
+		dir, err := s.Folder(name)
+		if err != nil {
+			return err
+		}
+		if err := fn(name, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package maildir
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// An EventType describes what happened to a message reported by Watch.
+type EventType int
+
+// The event types reported by Watch.
+const (
+	// EventDelivered indicates a new message arrived in new/.
+	EventDelivered EventType = iota
+	// EventSeen indicates a message moved from new/ to cur/.
+	EventSeen
+	// EventFlagsChanged indicates a message's flags were updated.
+	EventFlagsChanged
+	// EventRemoved indicates a message was purged.
+	EventRemoved
+)
+
+// An Event reports a single change to a message in a Dir, as produced
+// by Watch.
+type Event struct {
+	Key  string
+	Type EventType
+}
+
+// watchPollInterval is how often Watch falls back to re-scanning the
+// maildir when fsnotify can't be used, e.g. on network filesystems
+// where inotify is unreliable. It's a var, rather than a const, so
+// tests can shorten it.
+var watchPollInterval = 2 * time.Second
+
+// Watch reports deliveries, new/cur transitions, flag changes and
+// removals in d on the returned channel until ctx is cancelled, at
+// which point the channel is closed. It prefers fsnotify, falling back
+// to polling every watchPollInterval when the watched filesystem
+// doesn't support it, which includes any Dir not backed by OSFS, since
+// inotify and friends only know about the real, local filesystem.
+func (d Dir) Watch(ctx context.Context) (<-chan Event, error) {
+	events := make(chan Event)
+	if _, ok := d.fs().(OSFS); !ok {
+		go d.pollChanges(ctx, events)
+		return events, nil
+	}
+	watcher, err := newFsnotifyWatcher(d)
+	if err != nil {
+		go d.pollChanges(ctx, events)
+		return events, nil
+	}
+	go watcher.run(ctx, events)
+	return events, nil
+}
+
+// fsnotifyWatcher drives Watch using inotify (or the platform
+// equivalent). It keeps just enough state to tell apart a message's
+// first appearance in cur/ (EventSeen) from a later rename of the same
+// key (EventFlagsChanged).
+type fsnotifyWatcher struct {
+	dir     Dir
+	watcher *fsnotify.Watcher
+	inCur   map[string]bool
+}
+
+func newFsnotifyWatcher(d Dir) (*fsnotifyWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, subdir := range []string{"new", "cur"} {
+		if err := w.Add(filepath.Join(d.Path, subdir)); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	keys, err := d.Keys()
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	inCur := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		inCur[key] = true
+	}
+	return &fsnotifyWatcher{dir: d, watcher: w, inCur: inCur}, nil
+}
+
+func (w *fsnotifyWatcher) run(ctx context.Context, events chan<- Event) {
+	defer w.watcher.Close()
+	defer close(events)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if e, ok := w.classify(ev); ok {
+				if !sendEvent(ctx, events, e) {
+					return
+				}
+			}
+		case _, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// classify turns a raw fsnotify event into one of our Events, using
+// inCur to tell a new/->cur/ move from a same-directory flags rename.
+func (w *fsnotifyWatcher) classify(ev fsnotify.Event) (Event, bool) {
+	key, _ := w.dir.keyAndInfo(ev.Name)
+	indir := filepath.Base(filepath.Dir(ev.Name))
+
+	if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && indir == "new" {
+		return Event{}, false
+	}
+
+	switch {
+	case ev.Op&fsnotify.Remove != 0:
+		delete(w.inCur, key)
+		return Event{key, EventRemoved}, true
+	case ev.Op&fsnotify.Create != 0 && indir == "new":
+		return Event{key, EventDelivered}, true
+	case ev.Op&fsnotify.Create != 0 && indir == "cur":
+		// A flags-changing rename within cur/ raises two raw events, a
+		// Rename of the old name and a Create of the new one; only the
+		// Create side is classified here, so each change is reported
+		// exactly once.
+		if w.inCur[key] {
+			return Event{key, EventFlagsChanged}, true
+		}
+		w.inCur[key] = true
+		return Event{key, EventSeen}, true
+	}
+	return Event{}, false
+}
+
+// pollChanges implements the Watch fallback for filesystems where
+// fsnotify doesn't work, by periodically re-scanning new/ and cur/ and
+// diffing the result against the previous scan.
+func (d Dir) pollChanges(ctx context.Context, events chan<- Event) {
+	defer close(events)
+
+	prevNew := map[string]bool{}
+	prevCur := map[string]string{} // key -> flags
+
+	scan := func() bool {
+		newEntries, err := nonHiddenNames(d, "new")
+		if err != nil {
+			return true
+		}
+		curEntries, err := nonHiddenNames(d, "cur")
+		if err != nil {
+			return true
+		}
+
+		curNow := make(map[string]string, len(curEntries))
+		for _, n := range curEntries {
+			key, info := d.keyAndInfo(n)
+			curNow[key] = info
+		}
+		newNow := make(map[string]bool, len(newEntries))
+		for _, n := range newEntries {
+			key, _ := d.keyAndInfo(n)
+			newNow[key] = true
+			if !prevNew[key] {
+				if !sendEvent(ctx, events, Event{key, EventDelivered}) {
+					return false
+				}
+			}
+		}
+		for key, info := range curNow {
+			prevInfo, existed := prevCur[key]
+			switch {
+			case !existed:
+				if !sendEvent(ctx, events, Event{key, EventSeen}) {
+					return false
+				}
+			case info != prevInfo:
+				if !sendEvent(ctx, events, Event{key, EventFlagsChanged}) {
+					return false
+				}
+			}
+		}
+		for key := range prevCur {
+			if _, ok := curNow[key]; !ok {
+				if !sendEvent(ctx, events, Event{key, EventRemoved}) {
+					return false
+				}
+			}
+		}
+
+		prevNew, prevCur = newNow, curNow
+		return true
+	}
+
+	if !scan() {
+		return
+	}
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !scan() {
+				return
+			}
+		}
+	}
+}
+
+// sendEvent delivers e on events, returning false if ctx was cancelled
+// first.
+func sendEvent(ctx context.Context, events chan<- Event, e Event) bool {
+	select {
+	case events <- e:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// nonHiddenNames returns the non-hidden entry names of d's subdir
+// ("new" or "cur"), read through d's configured FS.
+func nonHiddenNames(d Dir, subdir string) ([]string, error) {
+	entries, err := d.fs().ReadDir(filepath.Join(d.Path, subdir))
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, entry := range entries {
+		if n := entry.Name(); n[0] != '.' {
+			out = append(out, n)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,115 @@
+package maildir
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeFS is a minimal, in-memory FS that only supports ReadDir, enough
+// to drive pollChanges without touching the real filesystem.
+type fakeFS struct {
+	mu   sync.Mutex
+	dirs map[string][]string // dir path -> names currently present
+}
+
+func newFakeFS() *fakeFS {
+	return &fakeFS{dirs: map[string][]string{}}
+}
+
+func (f *fakeFS) set(dir string, names ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dirs[dir] = append([]string(nil), names...)
+}
+
+func (f *fakeFS) ReadDir(name string) ([]os.DirEntry, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	entries := make([]os.DirEntry, 0, len(f.dirs[name]))
+	for _, n := range f.dirs[name] {
+		entries = append(entries, fakeDirEntry(n))
+	}
+	return entries, nil
+}
+
+func (f *fakeFS) Open(name string) (File, error)            { return nil, os.ErrNotExist }
+func (f *fakeFS) Create(name string) (File, error)          { return nil, os.ErrNotExist }
+func (f *fakeFS) Rename(oldpath, newpath string) error      { return os.ErrNotExist }
+func (f *fakeFS) Remove(name string) error                  { return os.ErrNotExist }
+func (f *fakeFS) RemoveAll(path string) error               { return os.ErrNotExist }
+func (f *fakeFS) Stat(name string) (os.FileInfo, error)     { return nil, os.ErrNotExist }
+func (f *fakeFS) Mkdir(name string, perm os.FileMode) error { return os.ErrNotExist }
+
+// fakeDirEntry is a bare file name pretending to be an os.DirEntry.
+type fakeDirEntry string
+
+func (n fakeDirEntry) Name() string      { return string(n) }
+func (n fakeDirEntry) IsDir() bool       { return false }
+func (n fakeDirEntry) Type() fs.FileMode { return 0 }
+func (n fakeDirEntry) Info() (fs.FileInfo, error) {
+	return nil, errors.New("fakeDirEntry: not implemented")
+}
+
+// waitEvent reads the next event off events, failing the test if none
+// arrives within a generous timeout.
+func waitEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return Event{}
+	}
+}
+
+func TestPollChanges(t *testing.T) {
+
+	t.Parallel()
+
+	orig := watchPollInterval
+	watchPollInterval = 10 * time.Millisecond
+	defer func() { watchPollInterval = orig }()
+
+	fsys := newFakeFS()
+	d := Dir{Path: "/fake/maildir", FS: fsys}
+
+	// A message is already sitting in new/ before Watch starts, so the
+	// very first scan should report it as delivered.
+	fsys.set(d.Path+"/new", "k1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan Event)
+	go d.pollChanges(ctx, events)
+
+	if e := waitEvent(t, events); e != (Event{"k1", EventDelivered}) {
+		t.Fatalf("got %+v, want EventDelivered for k1", e)
+	}
+
+	// new/ -> cur/ coalesces into a single EventSeen, not a delivery
+	// followed by a separate event.
+	fsys.set(d.Path + "/new")
+	fsys.set(d.Path+"/cur", "k1"+string(Separator)+"2,S")
+	if e := waitEvent(t, events); e != (Event{"k1", EventSeen}) {
+		t.Fatalf("got %+v, want EventSeen for k1", e)
+	}
+
+	// A flags-only rename within cur/ is reported as a change, not as a
+	// fresh delivery.
+	fsys.set(d.Path+"/cur", "k1"+string(Separator)+"2,RS")
+	if e := waitEvent(t, events); e != (Event{"k1", EventFlagsChanged}) {
+		t.Fatalf("got %+v, want EventFlagsChanged for k1", e)
+	}
+
+	// Removing the file from cur/ is reported once, as a removal.
+	fsys.set(d.Path + "/cur")
+	if e := waitEvent(t, events); e != (Event{"k1", EventRemoved}) {
+		t.Fatalf("got %+v, want EventRemoved for k1", e)
+	}
+}